@@ -0,0 +1,77 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package lockedfile provides advisory file locking for files that may be
+// concurrently read or rewritten by another process, such as a go.mod file
+// that an IDE, "go build", or another Gazelle invocation might be editing
+// at the same time.
+package lockedfile
+
+import "os"
+
+// Mutex guards access to the file at path using the platform's native
+// advisory locking primitive (flock on Unix, LockFileEx on Windows). It
+// does not prevent a non-cooperating process from ignoring the lock, but it is
+// sufficient to serialize well-behaved tools like the go command and
+// Gazelle itself.
+type Mutex struct {
+	path string
+}
+
+// New returns a Mutex guarding the file at path. The file does not need to
+// exist yet; it's created on first Lock call. RLock fails if the file does
+// not exist.
+func New(path string) *Mutex {
+	return &Mutex{path: path}
+}
+
+// Lock acquires an exclusive lock, blocking until it is available, and
+// returns a function that releases it.
+func (m *Mutex) Lock() (unlock func() error, err error) {
+	return m.acquire(true)
+}
+
+// RLock acquires a lock shared with other readers, blocking until it is
+// available, and returns a function that releases it.
+func (m *Mutex) RLock() (unlock func() error, err error) {
+	return m.acquire(false)
+}
+
+func (m *Mutex) acquire(exclusive bool) (unlock func() error, err error) {
+	flag := os.O_RDONLY
+	if exclusive {
+		// Only an exclusive lock might need to create or write the file
+		// (e.g. a go.sum that doesn't exist yet). A shared lock must not
+		// require write access, since it's commonly taken on files (like
+		// go.mod under a read-only Bazel execroot) the caller only reads.
+		flag = os.O_RDWR | os.O_CREATE
+	}
+	f, err := os.OpenFile(m.path, flag, 0o666)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, err
+	}
+	return func() error {
+		unlockErr := unlockFile(f)
+		closeErr := f.Close()
+		if unlockErr != nil {
+			return unlockErr
+		}
+		return closeErr
+	}, nil
+}
@@ -0,0 +1,61 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package saferexec wraps os/exec's PATH-based lookup so that callers never
+// launch an executable resolved from an unexpected location — in
+// particular, one found in the current working directory rather than an
+// explicit directory on PATH, which on Windows is a well-known
+// code-execution footgun (cmd.exe and LoadLibrary both search "." before
+// PATH). It plays the same role internal/execabs played for the go
+// command before PATH lookup was hardened in the standard library.
+package saferexec
+
+import (
+	"fmt"
+	"os/exec"
+	"path/filepath"
+)
+
+// LookPath resolves file via exec.LookPath and additionally requires the
+// result to be an absolute path. A relative result means the binary was
+// found via a PATH entry like "." — i.e., the current directory — which
+// os/exec (pre-Go 1.19) would happily execute.
+func LookPath(file string) (string, error) {
+	path, err := exec.LookPath(file)
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(path) {
+		return "", fmt.Errorf("saferexec: refusing to run %q resolved to non-absolute path %q (found via the current directory?)", file, path)
+	}
+	return path, nil
+}
+
+// Command is a drop-in replacement for exec.Command that resolves name
+// through LookPath first. If resolution fails, the returned *exec.Cmd
+// carries the error in its Err field, so Run/Output/Start return it
+// immediately instead of silently executing an unverified binary.
+func Command(name string, args ...string) *exec.Cmd {
+	path, err := LookPath(name)
+	if err != nil {
+		cmd := &exec.Cmd{
+			Path: name,
+			Args: append([]string{name}, args...),
+			Err:  err,
+		}
+		return cmd
+	}
+	return exec.Command(path, args...)
+}
@@ -0,0 +1,58 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package saferexec
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+)
+
+func TestLookPathRejectsRelative(t *testing.T) {
+	dir, err := ioutil.TempDir("", "saferexec-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	name := "fake-binary"
+	if runtime.GOOS == "windows" {
+		name += ".exe"
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, name), []byte("#!/bin/sh\n"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	rel := "." + string(filepath.Separator) + name
+	if _, err := LookPath(rel); err == nil {
+		t.Errorf("LookPath(%q) of an existing executable in the current directory succeeded; want error", rel)
+	}
+}
+
+func TestLookPathMissingBinary(t *testing.T) {
+	if _, err := LookPath("definitely-not-a-real-binary-gazelle-test"); err == nil {
+		t.Error("LookPath of a nonexistent binary succeeded; want error")
+	}
+}
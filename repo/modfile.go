@@ -0,0 +1,191 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+	"golang.org/x/mod/module"
+	"golang.org/x/mod/semver"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// modFileEntry tracks one require directive as it's resolved: its
+// (possibly replaced) effective module, and, once resolved, its sum.
+type modFileEntry struct {
+	replacedFrom string // non-empty if replaced by another module
+	mod          *modEntry
+}
+
+// importRepoRulesModFile is an alternative to importRepoRulesModules that
+// parses go.mod (and, for checksums, go.sum) directly with golang.org/x/mod
+// instead of invoking the "go" command. It performs no subprocess calls and
+// does not require a Go SDK to be installed, at the cost of only seeing the
+// modules named in go.mod's require block (not the fully resolved module
+// graph "go list -m all" would report).
+func importRepoRulesModFile(filename string, cache *RemoteCache) (repos []Repo, err error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	modFile, err := modfile.Parse(filename, data, nil)
+	if err != nil {
+		return nil, fmt.Errorf("parsing %s: %v", filename, err)
+	}
+
+	excluded := make(map[module.Version]bool)
+	for _, x := range modFile.Exclude {
+		excluded[x.Mod] = true
+	}
+
+	replace := make(map[string]*modfile.Replace)
+	for _, r := range modFile.Replace {
+		replace[r.Old.Path] = r
+	}
+
+	// Retractions in go.mod only apply to versions of the module declaring
+	// them, not to its dependencies, so they don't affect which modules we
+	// emit here. We still surface them as a warning in case the main
+	// module's own published version falls in a retracted range.
+	for _, r := range modFile.Retract {
+		if modFile.Module != nil {
+			log.Printf("go.mod retracts %s; if this version of %s has been published, consider a new release",
+				formatRetract(r), modFile.Module.Mod.Path)
+		}
+	}
+
+	sums, err := readGoSum(filepath.Join(filepath.Dir(filename), "go.sum"))
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	repos = make([]Repo, 0, len(modFile.Require))
+	var entries []modFileEntry
+	for _, req := range modFile.Require {
+		mod := req.Mod
+		if excluded[mod] {
+			continue
+		}
+
+		path, version := mod.Path, mod.Version
+		var replacedFrom string
+		if r, ok := replace[path]; ok {
+			if r.New.Version == "" {
+				// A replace directive with no version, e.g.
+				// "replace foo => ../vendored/foo", points at a
+				// filesystem path rather than another module.
+				repos = append(repos, Repo{
+					Name:      label.ImportPathToBazelRepoName(path),
+					GoPrefix:  path,
+					LocalPath: resolveLocalReplacePath(filename, r.New.Path),
+				})
+				continue
+			}
+			replacedFrom = path
+			path, version = r.New.Path, r.New.Version
+		}
+		version = canonicalVersion(version)
+
+		entries = append(entries, modFileEntry{
+			replacedFrom: replacedFrom,
+			mod: &modEntry{
+				Path:    path,
+				Version: version,
+				Sum:     sums[module.Version{Path: path, Version: version}],
+			},
+		})
+	}
+
+	if cache != nil && cache.UseNativeProxy {
+		var missing []*modEntry
+		for _, e := range entries {
+			if e.mod.Sum == "" {
+				missing = append(missing, e.mod)
+			}
+		}
+		resolveSumsConcurrently(missing, cache.Concurrency, newProxyFetcher().sum)
+	}
+
+	for _, e := range entries {
+		if e.mod.Sum == "" {
+			log.Printf("could not determine sum for module %s@%s", e.mod.Path, e.mod.Version)
+			continue
+		}
+		repo := Repo{
+			GoPrefix: e.mod.Path,
+			Version:  e.mod.Version,
+			Sum:      e.mod.Sum,
+		}
+		if e.replacedFrom != "" {
+			repo.Replace = e.mod.Path
+			repo.GoPrefix = e.replacedFrom
+		}
+		repo.Name = label.ImportPathToBazelRepoName(repo.GoPrefix)
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return repos, nil
+}
+
+// readGoSum parses a go.sum file into a map keyed by module path and
+// version, ignoring the separate "/go.mod" hash entries.
+func readGoSum(goSumPath string) (map[module.Version]string, error) {
+	data, err := ioutil.ReadFile(goSumPath)
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[module.Version]string)
+	for _, line := range bytes.Split(data, []byte("\n")) {
+		fields := bytes.Fields(line)
+		if len(fields) != 3 {
+			continue
+		}
+		path, version, sum := string(fields[0]), string(fields[1]), string(fields[2])
+		if strings.HasSuffix(version, "/go.mod") {
+			continue
+		}
+		sums[module.Version{Path: path, Version: canonicalVersion(version)}] = sum
+	}
+	return sums, nil
+}
+
+// canonicalVersion returns the canonical form of a module version string,
+// as recorded in go.sum, falling back to the original string if it isn't
+// a valid semantic version. Pseudo-versions such as
+// "v0.0.0-20200101000000-abcdef123456" are valid and already canonical, so
+// they come back unchanged.
+func canonicalVersion(version string) string {
+	if !semver.IsValid(version) {
+		return version
+	}
+	return module.CanonicalVersion(version)
+}
+
+func formatRetract(r *modfile.Retract) string {
+	if r.Low == r.High {
+		return r.Low
+	}
+	return fmt.Sprintf("[%s, %s]", r.Low, r.High)
+}
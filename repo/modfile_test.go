@@ -0,0 +1,206 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestImportRepoRulesModFileLocalReplace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gazelle-modfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goModPath := filepath.Join(dir, "go.mod")
+	goMod := `module example.com/main
+
+go 1.16
+
+require (
+	example.com/relative v1.0.0
+	example.com/absolute v1.2.3
+)
+
+replace example.com/relative => ../vendored/relative
+
+replace example.com/absolute v1.2.3 => /abs/path/to/absolute
+`
+	if err := ioutil.WriteFile(goModPath, []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := importRepoRulesModFile(goModPath, nil)
+	if err != nil {
+		t.Fatalf("importRepoRulesModFile: %v", err)
+	}
+
+	want := map[string]string{
+		"example.com/relative": filepath.Join(filepath.Dir(dir), "vendored", "relative"),
+		"example.com/absolute": filepath.Clean("/abs/path/to/absolute"),
+	}
+	got := map[string]string{}
+	for _, r := range repos {
+		if r.LocalPath != "" {
+			got[r.GoPrefix] = r.LocalPath
+		}
+	}
+	for prefix, wantPath := range want {
+		if got[prefix] != wantPath {
+			t.Errorf("LocalPath for %s = %q; want %q", prefix, got[prefix], wantPath)
+		}
+	}
+	if len(got) != len(want) {
+		t.Errorf("got %d local replacements, want %d: %v", len(got), len(want), got)
+	}
+}
+
+func TestImportRepoRulesModFileExclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gazelle-modfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goModPath := filepath.Join(dir, "go.mod")
+	goMod := `module example.com/main
+
+go 1.16
+
+require (
+	example.com/kept v1.0.0
+	example.com/excluded v1.0.0
+)
+
+exclude example.com/excluded v1.0.0
+`
+	if err := ioutil.WriteFile(goModPath, []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	goSum := "example.com/kept v1.0.0 h1:keptsum=\nexample.com/excluded v1.0.0 h1:excludedsum=\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.sum"), []byte(goSum), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := importRepoRulesModFile(goModPath, nil)
+	if err != nil {
+		t.Fatalf("importRepoRulesModFile: %v", err)
+	}
+
+	for _, r := range repos {
+		if r.GoPrefix == "example.com/excluded" {
+			t.Errorf("excluded module %s was still emitted as %+v", r.GoPrefix, r)
+		}
+	}
+	found := false
+	for _, r := range repos {
+		if r.GoPrefix == "example.com/kept" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("non-excluded module example.com/kept was not emitted; repos = %+v", repos)
+	}
+}
+
+func TestImportRepoRulesModFileRetract(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gazelle-modfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goModPath := filepath.Join(dir, "go.mod")
+	goMod := `module example.com/main
+
+go 1.16
+
+retract v1.0.0
+`
+	if err := ioutil.WriteFile(goModPath, []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	if _, err := importRepoRulesModFile(goModPath, nil); err != nil {
+		t.Fatalf("importRepoRulesModFile: %v", err)
+	}
+
+	if got := buf.String(); !strings.Contains(got, "v1.0.0") || !strings.Contains(got, "example.com/main") {
+		t.Errorf("expected a retraction warning mentioning v1.0.0 and example.com/main, got log output: %q", got)
+	}
+}
+
+func TestImportRepoRulesModFileReplaceModuleVersion(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gazelle-modfile-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goModPath := filepath.Join(dir, "go.mod")
+	goMod := `module example.com/main
+
+go 1.16
+
+require example.com/foo v1.0.0
+
+replace example.com/foo v1.0.0 => example.com/foofork v1.2.3
+`
+	if err := ioutil.WriteFile(goModPath, []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	goSum := "example.com/foofork v1.2.3 h1:foosum=\n"
+	if err := ioutil.WriteFile(filepath.Join(dir, "go.sum"), []byte(goSum), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := importRepoRulesModFile(goModPath, nil)
+	if err != nil {
+		t.Fatalf("importRepoRulesModFile: %v", err)
+	}
+	if len(repos) != 1 {
+		t.Fatalf("got %d repos, want 1: %+v", len(repos), repos)
+	}
+	r := repos[0]
+	if want := label.ImportPathToBazelRepoName("example.com/foo"); r.Name != want {
+		t.Errorf("Name = %q; want %q (derived from the pre-replace path, not the replacement's)", r.Name, want)
+	}
+	if r.GoPrefix != "example.com/foo" {
+		t.Errorf("GoPrefix = %q; want %q", r.GoPrefix, "example.com/foo")
+	}
+	if r.Replace != "example.com/foofork" {
+		t.Errorf("Replace = %q; want %q", r.Replace, "example.com/foofork")
+	}
+	if r.Version != "v1.2.3" {
+		t.Errorf("Version = %q; want %q", r.Version, "v1.2.3")
+	}
+	if r.Sum != "h1:foosum=" {
+		t.Errorf("Sum = %q; want %q", r.Sum, "h1:foosum=")
+	}
+}
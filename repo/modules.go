@@ -24,19 +24,44 @@ import (
 	"io/ioutil"
 	"log"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"runtime"
 	"sort"
 	"strings"
 
+	"github.com/bazelbuild/bazel-gazelle/internal/lockedfile"
+	"github.com/bazelbuild/bazel-gazelle/internal/saferexec"
 	"github.com/bazelbuild/bazel-gazelle/label"
 )
 
-func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err error) {
-	// Copy go.mod to temporary directory. We may run commands that modify it,
-	// and we want to leave the original alone.
-	tempDir, err := copyGoModToTemp(filename)
+// modEntry is the subset of "go list -m -json" fields importRepoRulesModules
+// needs to build Repo values.
+type modEntry struct {
+	Path, Version, Sum string
+	Main               bool
+	Replace            *struct {
+		Path, Version string
+	}
+	LocalPath string `json:"-"`
+}
+
+func importRepoRulesModules(filename string, cache *RemoteCache) (repos []Repo, err error) {
+	if cache != nil && cache.PreferVendor {
+		vendorModulesTxt := filepath.Join(filepath.Dir(filename), "vendor", "modules.txt")
+		if _, statErr := os.Stat(vendorModulesTxt); statErr == nil {
+			return importRepoRulesVendor(filename)
+		}
+	}
+	if cache != nil && cache.PreferModFile {
+		return importRepoRulesModFile(filename, cache)
+	}
+
+	// Snapshot go.mod (and go.sum, if present) to a temporary directory. We
+	// may run commands that modify them, and we want to leave the
+	// originals alone. The snapshot is taken under a shared lock so we
+	// don't race with another process rewriting go.mod/go.sum, and so the
+	// pair we read is mutually consistent.
+	tempDir, err := copyModAndSumToTemp(filename)
 	if err != nil {
 		return nil, err
 	}
@@ -44,21 +69,14 @@ func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err
 
 	// List all modules except for the main module, including implicit indirect
 	// dependencies.
-	type module struct {
-		Path, Version, Sum string
-		Main               bool
-		Replace            *struct {
-			Path, Version string
-		}
-	}
-	pathToModule := map[string]*module{}
+	pathToModule := map[string]*modEntry{}
 	data, err := goListModules(tempDir)
 	if err != nil {
 		return nil, err
 	}
 	dec := json.NewDecoder(bytes.NewReader(data))
 	for dec.More() {
-		mod := new(module)
+		mod := new(modEntry)
 		if err := dec.Decode(mod); err != nil {
 			return nil, err
 		}
@@ -67,8 +85,8 @@ func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err
 		}
 		if mod.Replace != nil {
 			if filepath.IsAbs(mod.Replace.Path) || build.IsLocalImport(mod.Replace.Path) {
-				log.Printf("go_repository does not support file path replacements for %s -> %s", mod.Path,
-					mod.Replace.Path)
+				mod.LocalPath = resolveLocalReplacePath(filename, mod.Replace.Path)
+				pathToModule[mod.Path] = mod
 				continue
 			}
 			pathToModule[mod.Replace.Path] = mod
@@ -77,9 +95,8 @@ func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err
 		}
 	}
 
-	// Load sums from go.sum. Ideally, they're all there.
-	goSumPath := filepath.Join(filepath.Dir(filename), "go.sum")
-	data, _ = ioutil.ReadFile(goSumPath)
+	// Load sums from the snapshotted go.sum. Ideally, they're all there.
+	data, _ = ioutil.ReadFile(filepath.Join(tempDir, "go.sum"))
 	lines := bytes.Split(data, []byte("\n"))
 	for _, line := range lines {
 		line = bytes.TrimSpace(line)
@@ -96,40 +113,37 @@ func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err
 		}
 	}
 
-	// If sums are missing, run go mod download to get them.
-	var missingSumArgs []string
+	// If sums are missing, resolve them either from a module proxy directly
+	// or by running "go mod download", depending on cache's configuration.
+	var missing []*modEntry
 	for _, mod := range pathToModule {
-		if mod.Sum == "" {
-			if mod.Replace != nil {
-				missingSumArgs = append(missingSumArgs, fmt.Sprintf("%s@%s", mod.Replace.Path, mod.Replace.Version))
-			} else {
-				missingSumArgs = append(missingSumArgs, fmt.Sprintf("%s@%s", mod.Path, mod.Version))
-			}
+		if mod.Sum == "" && mod.LocalPath == "" {
+			missing = append(missing, mod)
 		}
 	}
-	if len(missingSumArgs) > 0 {
-		data, err := goModDownload(tempDir, missingSumArgs)
-		if err != nil {
+
+	configuredConcurrency := 0
+	if cache != nil {
+		configuredConcurrency = cache.Concurrency
+	}
+	if cache != nil && cache.UseNativeProxy {
+		resolveSumsConcurrently(missing, configuredConcurrency, newProxyFetcher().sum)
+	} else if len(missing) > 0 {
+		if err := downloadSumsConcurrently(tempDir, missing, configuredConcurrency, pathToModule); err != nil {
 			return nil, err
 		}
-		dec = json.NewDecoder(bytes.NewReader(data))
-		for dec.More() {
-			var dl module
-			if err := dec.Decode(&dl); err != nil {
-				return nil, err
-			}
-			mod := pathToModule[dl.Path]
-			if mod == nil {
-				continue
-			}
-			mod.Sum = dl.Sum
+	}
+
+	if cache != nil && cache.WriteSums {
+		if err := writeSumsBack(filename, pathToModule); err != nil {
+			return nil, err
 		}
 	}
 
 	// Translate to repo metadata.
 	repos = make([]Repo, 0, len(pathToModule))
 	for _, mod := range pathToModule {
-		if mod.Sum == "" {
+		if mod.LocalPath == "" && mod.Sum == "" {
 			log.Printf("could not determine sum for module %s", mod.Path)
 			continue
 		}
@@ -139,7 +153,10 @@ func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err
 			Version:  mod.Version,
 			Sum:      mod.Sum,
 		}
-		if mod.Replace != nil {
+		if mod.LocalPath != "" {
+			repo.LocalPath = mod.LocalPath
+			repo.Version = ""
+		} else if mod.Replace != nil {
 			repo.Replace = mod.Replace.Path
 			repo.Version = mod.Replace.Version
 		}
@@ -151,8 +168,11 @@ func importRepoRulesModules(filename string, _ *RemoteCache) (repos []Repo, err
 
 // goListModules invokes "go list" in a directory containing a go.mod file.
 var goListModules = func(dir string) ([]byte, error) {
-	goTool := findGoTool()
-	cmd := exec.Command(goTool, "list", "-m", "-json", "all")
+	goTool, err := findGoTool()
+	if err != nil {
+		return nil, err
+	}
+	cmd := saferexec.Command(goTool, "list", "-m", "-json", "all")
 	cmd.Stderr = os.Stderr
 	cmd.Dir = dir
 	return cmd.Output()
@@ -161,45 +181,152 @@ var goListModules = func(dir string) ([]byte, error) {
 // goModDownload invokes "go mod download" in a directory containing a
 // go.mod file.
 var goModDownload = func(dir string, args []string) ([]byte, error) {
-	goTool := findGoTool()
-	cmd := exec.Command(goTool, "mod", "download", "-json")
+	goTool, err := findGoTool()
+	if err != nil {
+		return nil, err
+	}
+	cmd := saferexec.Command(goTool, "mod", "download", "-json")
 	cmd.Args = append(cmd.Args, args...)
 	cmd.Stderr = os.Stderr
 	cmd.Dir = dir
 	return cmd.Output()
 }
 
-// copyGoModToTemp copies to given go.mod file to a temporary directory.
-// go list tends to mutate go.mod files, but gazelle shouldn't do that.
-func copyGoModToTemp(filename string) (tempDir string, err error) {
-	goModOrig, err := os.Open(filename)
+// copyModAndSumToTemp copies the given go.mod file, and its sibling go.sum
+// if one exists, into a new temporary directory. go list and go mod
+// download tend to mutate go.mod/go.sum, but gazelle shouldn't do that to
+// the user's files. The copy is taken while holding a shared lock on
+// go.mod, so the go.mod/go.sum pair we read is consistent even if another
+// process (an IDE, "go build", another Gazelle invocation) is rewriting
+// them concurrently.
+func copyModAndSumToTemp(filename string) (tempDir string, err error) {
+	mu := lockedfile.New(filename)
+	unlock, err := mu.RLock()
 	if err != nil {
 		return "", err
 	}
-	defer goModOrig.Close()
+	defer unlock()
 
 	tempDir, err = ioutil.TempDir("", "gazelle-temp-gomod")
 	if err != nil {
 		return "", err
 	}
 
-	goModCopy, err := os.Create(filepath.Join(tempDir, "go.mod"))
-	if err != nil {
-		os.Remove(tempDir)
+	if err := copyFile(filename, filepath.Join(tempDir, "go.mod")); err != nil {
+		os.RemoveAll(tempDir)
+		return "", err
+	}
+
+	goSumPath := filepath.Join(filepath.Dir(filename), "go.sum")
+	if err := copyFile(goSumPath, filepath.Join(tempDir, "go.sum")); err != nil && !os.IsNotExist(err) {
+		os.RemoveAll(tempDir)
 		return "", err
 	}
+
+	return tempDir, nil
+}
+
+func copyFile(src, dst string) (err error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
 	defer func() {
-		if cerr := goModCopy.Close(); err == nil && cerr != nil {
+		if cerr := out.Close(); err == nil && cerr != nil {
 			err = cerr
 		}
 	}()
 
-	_, err = io.Copy(goModCopy, goModOrig)
+	_, err = io.Copy(out, in)
+	return err
+}
+
+// writeSumsBack writes newly-resolved sums in pathToModule back to the
+// go.mod file's sibling go.sum, under an exclusive lock on go.mod (the same
+// file copyModAndSumToTemp takes its shared lock on). Existing go.sum lines
+// are kept; only modules it doesn't already list are appended. Callers opt
+// in via RemoteCache.WriteSums, since rewriting a file gazelle doesn't own
+// is surprising default behavior. Unlike the go command, this only adds the
+// h1: module hash used to verify go_repository downloads, not the separate
+// go.mod-only hashes cmd/go also tracks.
+func writeSumsBack(filename string, pathToModule map[string]*modEntry) error {
+	goSumPath := filepath.Join(filepath.Dir(filename), "go.sum")
+	mu := lockedfile.New(filename)
+	unlock, err := mu.Lock()
 	if err != nil {
-		os.RemoveAll(tempDir)
-		return "", err
+		return err
 	}
-	return tempDir, err
+	defer unlock()
+
+	existing, err := ioutil.ReadFile(goSumPath)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	recorded := make(map[string]bool)
+	for _, line := range bytes.Split(existing, []byte("\n")) {
+		if fields := bytes.Fields(line); len(fields) == 3 {
+			recorded[string(fields[0])+" "+string(fields[1])] = true
+		}
+	}
+
+	paths := make([]string, 0, len(pathToModule))
+	for path := range pathToModule {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+
+	var buf bytes.Buffer
+	buf.Write(existing)
+	if len(existing) > 0 && existing[len(existing)-1] != '\n' {
+		buf.WriteByte('\n')
+	}
+	for _, path := range paths {
+		mod := pathToModule[path]
+		if mod.Sum == "" || mod.LocalPath != "" {
+			continue
+		}
+		version := mod.Version
+		if mod.Replace != nil {
+			version = mod.Replace.Version
+		}
+		if recorded[path+" "+version] {
+			continue
+		}
+		fmt.Fprintf(&buf, "%s %s %s\n", path, version, mod.Sum)
+	}
+
+	tmp, err := ioutil.TempFile(filepath.Dir(goSumPath), "go.sum.tmp-*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(buf.Bytes()); err != nil {
+		tmp.Close()
+		os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		os.Remove(tmpName)
+		return err
+	}
+	return os.Rename(tmpName, goSumPath)
+}
+
+// resolveLocalReplacePath resolves the target of a "replace" directive that
+// points at a filesystem path rather than a module, relative to the
+// directory containing the go.mod file it was declared in, matching
+// cmd/go's semantics. The result is cleaned and uses OS-native separators.
+func resolveLocalReplacePath(goModFilename, replacePath string) string {
+	if !filepath.IsAbs(replacePath) {
+		replacePath = filepath.Join(filepath.Dir(goModFilename), replacePath)
+	}
+	return filepath.Clean(replacePath)
 }
 
 // findGoTool attempts to locate the go executable. If GOROOT is set, we'll
@@ -207,13 +334,21 @@ func copyGoModToTemp(filename string) (tempDir string, err error) {
 // script generated by the gazelle rule is invoked by Bazel, it will set
 // GOROOT to the configured SDK. We don't want to rely on the host SDK in
 // that situation.
-func findGoTool() string {
-	path := "go" // rely on PATH by default
+//
+// The returned path is always absolute. If it can't be resolved to one —
+// in particular, if PATH lookup would have run a binary discovered in the
+// current directory — an error is returned instead of silently falling
+// back to an unqualified name for exec.Command to resolve.
+func findGoTool() (string, error) {
+	name := "go" // rely on PATH by default
 	if goroot, ok := os.LookupEnv("GOROOT"); ok {
-		path = filepath.Join(goroot, "bin", "go")
+		name = filepath.Join(goroot, "bin", "go")
 	}
 	if runtime.GOOS == "windows" {
-		path += ".exe"
+		name += ".exe"
+	}
+	if filepath.IsAbs(name) {
+		return name, nil
 	}
-	return path
+	return saferexec.LookPath(name)
 }
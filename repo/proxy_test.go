@@ -0,0 +1,118 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestServer(t *testing.T, status int, body string) *httptest.Server {
+	t.Helper()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(status)
+		w.Write([]byte(body))
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestFetchCommaFallsBackOnNotFound(t *testing.T) {
+	notFound := newTestServer(t, http.StatusNotFound, "")
+	ok := newTestServer(t, http.StatusOK, "found")
+
+	f := &proxyFetcher{
+		groups: [][]string{{notFound.URL}, {ok.URL}},
+		client: http.DefaultClient,
+	}
+	data, err := f.fetch("/mod/@v/v1.0.0.info")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(data) != "found" {
+		t.Errorf("fetch returned %q; want %q", data, "found")
+	}
+}
+
+func TestFetchCommaStopsOnNonNotFoundError(t *testing.T) {
+	var secondHit bool
+	broken := newTestServer(t, http.StatusInternalServerError, "")
+	second := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		secondHit = true
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer second.Close()
+
+	f := &proxyFetcher{
+		groups: [][]string{{broken.URL}, {second.URL}},
+		client: http.DefaultClient,
+	}
+	if _, err := f.fetch("/mod/@v/v1.0.0.info"); err == nil {
+		t.Fatal("fetch succeeded; want a terminal error from the first, non-404 proxy")
+	}
+	if secondHit {
+		t.Error("fetch consulted the second comma-separated proxy after a non-404/410 error; it should have stopped")
+	}
+}
+
+func TestFetchPipeFallsBackOnAnyError(t *testing.T) {
+	broken := newTestServer(t, http.StatusInternalServerError, "")
+	ok := newTestServer(t, http.StatusOK, "found")
+
+	f := &proxyFetcher{
+		groups: [][]string{{broken.URL, ok.URL}},
+		client: http.DefaultClient,
+	}
+	data, err := f.fetch("/mod/@v/v1.0.0.info")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(data) != "found" {
+		t.Errorf("fetch returned %q; want %q", data, "found")
+	}
+}
+
+func TestFetchDirectSentinelDoesNotBlockLaterCommaProxy(t *testing.T) {
+	ok := newTestServer(t, http.StatusOK, "found")
+
+	f := &proxyFetcher{
+		groups: [][]string{{"direct"}, {ok.URL}},
+		client: http.DefaultClient,
+	}
+	data, err := f.fetch("/mod/@v/v1.0.0.info")
+	if err != nil {
+		t.Fatalf("fetch: %v", err)
+	}
+	if string(data) != "found" {
+		t.Errorf("fetch returned %q; want %q", data, "found")
+	}
+}
+
+func TestIsPrivate(t *testing.T) {
+	f := &proxyFetcher{private: []string{"corp.example.com/*", "internal.example.com"}}
+
+	cases := map[string]bool{
+		"corp.example.com/team/repo": true,
+		"internal.example.com":       true,
+		"github.com/pkg/errors":      false,
+	}
+	for modPath, want := range cases {
+		if got := f.isPrivate(modPath); got != want {
+			t.Errorf("isPrivate(%q) = %v; want %v", modPath, got, want)
+		}
+	}
+}
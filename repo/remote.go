@@ -0,0 +1,58 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+// RemoteCache holds configuration and memoized results for operations that
+// consult external sources (the Go toolchain, module proxies, etc.) when
+// generating repository rules. A single RemoteCache is normally shared
+// across an entire Gazelle run.
+type RemoteCache struct {
+	// PreferModFile, when set, tells importRepoRulesModules to parse
+	// go.mod/go.sum directly with golang.org/x/mod instead of shelling
+	// out to the Go toolchain. This avoids the cost (and the requirement
+	// of a working Go SDK) of invoking "go list" and "go mod download".
+	PreferModFile bool
+
+	// UseNativeProxy, when set, tells importRepoRulesModules to resolve
+	// go.sum entries missing a hash by talking to a GOPROXY-protocol
+	// module proxy directly, instead of running "go mod download". This
+	// also governs sum resolution on the PreferModFile path, which has no
+	// "go mod download" fallback of its own: with PreferModFile set and
+	// UseNativeProxy unset, modules missing a go.sum entry are dropped
+	// instead of resolved.
+	UseNativeProxy bool
+
+	// PreferVendor, when set, tells importRepoRulesModules to read
+	// vendor/modules.txt next to go.mod (if it exists) as the source of
+	// repository metadata, instead of the Go toolchain or go.mod/go.sum.
+	// This allows generating go_repository rules for air-gapped, vendored
+	// builds with no network access at all. Takes priority over
+	// PreferModFile.
+	PreferVendor bool
+
+	// WriteSums, when set, tells importRepoRulesModules to write sums it
+	// resolved (e.g. via "go mod download" or the native proxy fetcher)
+	// back to the go.mod file's sibling go.sum, under an exclusive lock.
+	// By default, newly-resolved sums are only kept in memory for the
+	// current run; gazelle doesn't rewrite files it doesn't own unless
+	// asked to.
+	WriteSums bool
+
+	// Concurrency is the maximum number of sum resolutions (native proxy
+	// fetches, or "go mod download" batches) to run at once. Zero means
+	// use a default based on runtime.NumCPU().
+	Concurrency int
+}
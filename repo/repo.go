@@ -0,0 +1,54 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+// Repo describes an external repository rule declared in a build file or
+// generated from a lockfile such as go.mod.
+type Repo struct {
+	// Name is the canonical external repository name, e.g.
+	// "com_github_pkg_errors".
+	Name string
+
+	// GoPrefix is the portion of the Go import path for this repository
+	// that corresponds to the repository root, e.g. "github.com/pkg/errors".
+	GoPrefix string
+
+	// Version is the version of the repository to be fetched. This is
+	// usually a Bazel label-compatible form of a Go version string, e.g.
+	// "v1.0.0" or a pseudo-version.
+	Version string
+
+	// Sum is the Go module checksum for this version, e.g.
+	// "h1:abc123...=". It's empty if the repository was not resolved
+	// from a go.mod/go.sum pair.
+	Sum string
+
+	// Replace is the GoPrefix of a replacement for this repository,
+	// if one was declared with a "replace" directive in go.mod. It's
+	// empty if there is no replacement.
+	Replace string
+
+	// LocalPath is an absolute, OS-native filesystem path this repository
+	// should be read from instead of being downloaded. It's set when
+	// go.mod replaces this module with a filesystem path (e.g.
+	// "replace foo => ../vendored/foo") rather than another module, and
+	// for every repository read from vendor/modules.txt, where it names the
+	// module's directory under vendor/.
+	// When set, Version and Sum are meaningless and should be ignored;
+	// callers should generate a local_repository rule (or equivalent)
+	// instead of go_repository.
+	LocalPath string
+}
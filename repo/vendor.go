@@ -0,0 +1,130 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"go/build"
+	"io/ioutil"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"golang.org/x/mod/modfile"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// vendorModule is one "# module version[ => replacement]" entry parsed from
+// vendor/modules.txt.
+type vendorModule struct {
+	Path           string
+	Version        string
+	ReplacePath    string
+	ReplaceVersion string
+	Explicit       bool
+}
+
+// importRepoRulesVendor is a sibling of importRepoRulesModules that reads
+// vendor/modules.txt next to the given go.mod file instead of consulting
+// the Go toolchain or a module proxy. It mirrors the way cmd/go treats
+// vendor/modules.txt as authoritative in -mod=vendor mode, letting
+// air-gapped builds generate go_repository rules with no network access.
+func importRepoRulesVendor(filename string) (repos []Repo, err error) {
+	vendorDir := filepath.Join(filepath.Dir(filename), "vendor")
+	modulesTxtPath := filepath.Join(vendorDir, "modules.txt")
+	data, err := ioutil.ReadFile(modulesTxtPath)
+	if err != nil {
+		return nil, err
+	}
+	vendorMods := parseModulesTxt(data)
+
+	if goModData, err := ioutil.ReadFile(filename); err == nil {
+		if modFile, err := modfile.Parse(filename, goModData, nil); err == nil {
+			required := make(map[string]bool, len(modFile.Require))
+			for _, req := range modFile.Require {
+				required[req.Mod.Path] = true
+			}
+			for _, vm := range vendorMods {
+				if !required[vm.Path] {
+					log.Printf("vendor/modules.txt lists %s, but it is not required by %s", vm.Path, filename)
+				}
+			}
+		}
+	}
+
+	repos = make([]Repo, 0, len(vendorMods))
+	for _, vm := range vendorMods {
+		repo := Repo{
+			Name:      label.ImportPathToBazelRepoName(vm.Path),
+			GoPrefix:  vm.Path,
+			Version:   vm.Version,
+			LocalPath: filepath.Join(vendorDir, filepath.FromSlash(vm.Path)),
+		}
+		if vm.ReplacePath != "" && !filepath.IsAbs(vm.ReplacePath) && !build.IsLocalImport(vm.ReplacePath) {
+			// Vendored code for a module-to-module replacement still lives
+			// under the original import path; record the replacement for
+			// informational purposes only.
+			repo.Replace = vm.ReplacePath
+			repo.Version = vm.ReplaceVersion
+		}
+		repos = append(repos, repo)
+	}
+	sort.Slice(repos, func(i, j int) bool { return repos[i].Name < repos[j].Name })
+	return repos, nil
+}
+
+// parseModulesTxt parses the "# module version[ => replacement]" and
+// "## explicit" header lines of a vendor/modules.txt file. Package path
+// lines (which list the packages vendored from the preceding module) are
+// ignored; we only need module-level metadata to generate repository rules.
+func parseModulesTxt(data []byte) []vendorModule {
+	var mods []vendorModule
+	var cur *vendorModule
+	for _, lineBytes := range bytes.Split(data, []byte("\n")) {
+		line := strings.TrimRight(string(lineBytes), "\r")
+		switch {
+		case strings.HasPrefix(line, "## "):
+			if cur != nil && strings.TrimSpace(strings.TrimPrefix(line, "##")) == "explicit" {
+				cur.Explicit = true
+			}
+		case strings.HasPrefix(line, "# "):
+			fields := strings.Fields(strings.TrimPrefix(line, "# "))
+			if len(fields) == 0 {
+				continue
+			}
+			mod := vendorModule{Path: fields[0]}
+			rest := fields[1:]
+			if len(rest) > 0 && rest[0] != "=>" {
+				mod.Version = rest[0]
+				rest = rest[1:]
+			}
+			if len(rest) > 0 && rest[0] == "=>" {
+				rest = rest[1:]
+				if len(rest) > 0 {
+					mod.ReplacePath = rest[0]
+				}
+				if len(rest) > 1 {
+					mod.ReplaceVersion = rest[1]
+				}
+			}
+			mods = append(mods, mod)
+			cur = &mods[len(mods)-1]
+		}
+	}
+	return mods
+}
@@ -0,0 +1,131 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+func TestParseModulesTxt(t *testing.T) {
+	data := []byte(`# github.com/pkg/errors v0.9.1
+## explicit
+github.com/pkg/errors
+# golang.org/x/sys v0.0.0-20210124154548-22da62e12c0d => golang.org/x/sys v0.0.0-20201119102817-f84b799fce68
+## explicit
+golang.org/x/sys/unix
+# rsc.io/quote v1.5.2
+rsc.io/quote
+`)
+	got := parseModulesTxt(data)
+	want := []vendorModule{
+		{Path: "github.com/pkg/errors", Version: "v0.9.1", Explicit: true},
+		{
+			Path:           "golang.org/x/sys",
+			Version:        "v0.0.0-20210124154548-22da62e12c0d",
+			ReplacePath:    "golang.org/x/sys",
+			ReplaceVersion: "v0.0.0-20201119102817-f84b799fce68",
+			Explicit:       true,
+		},
+		{Path: "rsc.io/quote", Version: "v1.5.2"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("parseModulesTxt() = %#v; want %#v", got, want)
+	}
+}
+
+func TestImportRepoRulesVendor(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gazelle-vendor-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	goModPath := filepath.Join(dir, "go.mod")
+	goMod := `module example.com/main
+
+go 1.16
+
+require (
+	github.com/pkg/errors v0.9.1
+	golang.org/x/sys v0.0.0-20210124154548-22da62e12c0d
+)
+`
+	if err := ioutil.WriteFile(goModPath, []byte(goMod), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	vendorDir := filepath.Join(dir, "vendor")
+	if err := os.MkdirAll(vendorDir, 0o755); err != nil {
+		t.Fatal(err)
+	}
+	modulesTxt := `# github.com/pkg/errors v0.9.1
+## explicit
+github.com/pkg/errors
+# golang.org/x/sys v0.0.0-20210124154548-22da62e12c0d => golang.org/x/sys v0.0.0-20201119102817-f84b799fce68
+## explicit
+golang.org/x/sys/unix
+`
+	if err := ioutil.WriteFile(filepath.Join(vendorDir, "modules.txt"), []byte(modulesTxt), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	repos, err := importRepoRulesVendor(goModPath)
+	if err != nil {
+		t.Fatalf("importRepoRulesVendor: %v", err)
+	}
+	if len(repos) != 2 {
+		t.Fatalf("got %d repos, want 2: %+v", len(repos), repos)
+	}
+
+	byPrefix := map[string]Repo{}
+	for _, r := range repos {
+		byPrefix[r.GoPrefix] = r
+	}
+
+	errorsRepo, ok := byPrefix["github.com/pkg/errors"]
+	if !ok {
+		t.Fatalf("no repo for github.com/pkg/errors; repos = %+v", repos)
+	}
+	if want := label.ImportPathToBazelRepoName("github.com/pkg/errors"); errorsRepo.Name != want {
+		t.Errorf("Name = %q; want %q", errorsRepo.Name, want)
+	}
+	if want := filepath.Join(vendorDir, "github.com", "pkg", "errors"); errorsRepo.LocalPath != want {
+		t.Errorf("LocalPath = %q; want %q", errorsRepo.LocalPath, want)
+	}
+	if errorsRepo.Replace != "" {
+		t.Errorf("Replace = %q; want empty (no replace directive)", errorsRepo.Replace)
+	}
+
+	sysRepo, ok := byPrefix["golang.org/x/sys"]
+	if !ok {
+		t.Fatalf("no repo for golang.org/x/sys; repos = %+v", repos)
+	}
+	if want := filepath.Join(vendorDir, "golang.org", "x", "sys"); sysRepo.LocalPath != want {
+		t.Errorf("LocalPath = %q; want %q", sysRepo.LocalPath, want)
+	}
+	if sysRepo.Replace != "golang.org/x/sys" {
+		t.Errorf("Replace = %q; want %q", sysRepo.Replace, "golang.org/x/sys")
+	}
+	if sysRepo.Version != "v0.0.0-20201119102817-f84b799fce68" {
+		t.Errorf("Version = %q; want the replacement's version, got %q", sysRepo.Version, sysRepo.Version)
+	}
+}
@@ -0,0 +1,174 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+// concurrencyOrDefault returns n if positive, or else a reasonable default
+// based on the number of available CPUs.
+func concurrencyOrDefault(n int) int {
+	if n > 0 {
+		return n
+	}
+	if n := runtime.NumCPU(); n > 0 {
+		return n
+	}
+	return 1
+}
+
+// resolveSumsConcurrently resolves the sum for each module in mods using
+// resolve, running up to concurrency resolutions at once. It mutates each
+// module's Sum field in place. Failures don't stop other workers; they're
+// collected and logged in a deterministic, path-sorted order once every
+// worker has finished, rather than interleaved as workers complete.
+func resolveSumsConcurrently(mods []*modEntry, concurrency int, resolve func(path, version string) (sum string, err error)) {
+	if len(mods) == 0 {
+		return
+	}
+	concurrency = concurrencyOrDefault(concurrency)
+	if concurrency > len(mods) {
+		concurrency = len(mods)
+	}
+
+	type failure struct {
+		path string
+		err  error
+	}
+	var (
+		mu       sync.Mutex
+		failures []failure
+		wg       sync.WaitGroup
+	)
+
+	jobs := make(chan *modEntry)
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for mod := range jobs {
+				path, version := mod.Path, mod.Version
+				if mod.Replace != nil {
+					path, version = mod.Replace.Path, mod.Replace.Version
+				}
+				sum, err := resolve(path, version)
+				if err != nil {
+					mu.Lock()
+					failures = append(failures, failure{path, err})
+					mu.Unlock()
+					continue
+				}
+				mod.Sum = sum
+			}
+		}()
+	}
+	for _, mod := range mods {
+		jobs <- mod
+	}
+	close(jobs)
+	wg.Wait()
+
+	sort.Slice(failures, func(i, j int) bool { return failures[i].path < failures[j].path })
+	for _, f := range failures {
+		log.Printf("could not determine sum for module %s: %v", f.path, f.err)
+	}
+}
+
+// downloadSumsConcurrently resolves sums for the given modules by sharding
+// them into concurrency batches and invoking goModDownload for each batch
+// at the same time, merging the decoded results into pathToModule under a
+// mutex. This avoids serializing the network I/O "go mod download" does
+// internally when a monorepo's go.sum has hundreds of missing entries.
+func downloadSumsConcurrently(dir string, missing []*modEntry, concurrency int, pathToModule map[string]*modEntry) error {
+	if len(missing) == 0 {
+		return nil
+	}
+
+	args := make([]string, len(missing))
+	for i, mod := range missing {
+		path, version := mod.Path, mod.Version
+		if mod.Replace != nil {
+			path, version = mod.Replace.Path, mod.Replace.Version
+		}
+		args[i] = fmt.Sprintf("%s@%s", path, version)
+	}
+
+	concurrency = concurrencyOrDefault(concurrency)
+	if concurrency > len(args) {
+		concurrency = len(args)
+	}
+	batches := shardStrings(args, concurrency)
+
+	var (
+		mu   sync.Mutex
+		wg   sync.WaitGroup
+		errs = make([]error, len(batches))
+	)
+	for i, batch := range batches {
+		if len(batch) == 0 {
+			continue
+		}
+		wg.Add(1)
+		go func(i int, batch []string) {
+			defer wg.Done()
+			data, err := goModDownload(dir, batch)
+			if err != nil {
+				errs[i] = err
+				return
+			}
+			dec := json.NewDecoder(bytes.NewReader(data))
+			for dec.More() {
+				var dl modEntry
+				if err := dec.Decode(&dl); err != nil {
+					errs[i] = err
+					return
+				}
+				mu.Lock()
+				if mod := pathToModule[dl.Path]; mod != nil {
+					mod.Sum = dl.Sum
+				}
+				mu.Unlock()
+			}
+		}(i, batch)
+	}
+	wg.Wait()
+
+	for _, err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// shardStrings splits items into n roughly-equal, order-preserving shards.
+func shardStrings(items []string, n int) [][]string {
+	if n <= 0 {
+		n = 1
+	}
+	shards := make([][]string, n)
+	for i, item := range items {
+		shards[i%n] = append(shards[i%n], item)
+	}
+	return shards
+}
@@ -0,0 +1,54 @@
+/* Copyright 2018 The Bazel Authors. All rights reserved.
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+   http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package repo
+
+import (
+	"fmt"
+	"testing"
+	"time"
+)
+
+// syntheticModules builds n modules with distinct, missing sums, simulating
+// a large monorepo's go.sum.
+func syntheticModules(n int) []*modEntry {
+	mods := make([]*modEntry, n)
+	for i := range mods {
+		mods[i] = &modEntry{
+			Path:    fmt.Sprintf("example.com/mod%d", i),
+			Version: "v1.0.0",
+		}
+	}
+	return mods
+}
+
+// fakeNetworkResolve simulates the latency of a single module proxy round
+// trip, without making any real network calls.
+func fakeNetworkResolve(path, version string) (string, error) {
+	time.Sleep(time.Millisecond)
+	return "h1:" + path + "@" + version, nil
+}
+
+func BenchmarkResolveSumsSerial(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		resolveSumsConcurrently(syntheticModules(500), 1, fakeNetworkResolve)
+	}
+}
+
+func BenchmarkResolveSumsParallel(b *testing.B) {
+	for i := 0; i < b.N; i++ {
+		resolveSumsConcurrently(syntheticModules(500), 32, fakeNetworkResolve)
+	}
+}